@@ -20,8 +20,38 @@ var (
 	NoSupportedAuth = fmt.Errorf("no supported authentication mechanism")
 )
 
+// AuthContext carries the outcome of authentication to the rest of the
+// request pipeline via Request.AuthContext. Method records the selected
+// auth method, and Payload holds identity details (e.g. "Username").
+// WrappedReader/WrappedWriter, when set, must replace the raw connection
+// for the request phase (see GSSAPIAuthenticator).
+type AuthContext struct {
+	Method        uint8
+	Payload       map[string]string
+	WrappedReader io.Reader
+	WrappedWriter io.Writer
+}
+
+// authContextKey is the unexported context.Context key used to thread an
+// AuthContext through calls, such as NameResolver.Resolve, that don't
+// take a *Request directly.
+type authContextKey struct{}
+
+// contextWithAuth returns a copy of ctx carrying authCtx, retrievable
+// with AuthContextFromContext.
+func contextWithAuth(ctx context.Context, authCtx *AuthContext) context.Context {
+	return context.WithValue(ctx, authContextKey{}, authCtx)
+}
+
+// AuthContextFromContext extracts the AuthContext attached by
+// contextWithAuth, e.g. from within a NameResolver.Resolve implementation.
+func AuthContextFromContext(ctx context.Context) (*AuthContext, bool) {
+	authCtx, ok := ctx.Value(authContextKey{}).(*AuthContext)
+	return authCtx, ok
+}
+
 type Authenticator interface {
-	Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (context.Context, error)
+	Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (*AuthContext, error)
 	GetCode() uint8
 }
 
@@ -32,9 +62,11 @@ func (a NoAuthAuthenticator) GetCode() uint8 {
 	return NoAuth
 }
 
-func (a NoAuthAuthenticator) Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (context.Context, error) {
-	_, err := writer.Write([]byte{socks5Version, NoAuth})
-	return ctx, err
+func (a NoAuthAuthenticator) Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (*AuthContext, error) {
+	if _, err := writer.Write([]byte{socks5Version, NoAuth}); err != nil {
+		return nil, err
+	}
+	return &AuthContext{Method: NoAuth}, nil
 }
 
 // UserPassAuthenticator is used to handle username/password based
@@ -47,77 +79,91 @@ func (a UserPassAuthenticator) GetCode() uint8 {
 	return UserPassAuth
 }
 
-func (a UserPassAuthenticator) Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (context.Context, error) {
+func (a UserPassAuthenticator) Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (*AuthContext, error) {
 	// Tell the client to use user/pass auth
 	if _, err := writer.Write([]byte{socks5Version, UserPassAuth}); err != nil {
-		return ctx, err
+		return nil, err
 	}
 
 	// Get the version and username length
 	header := []byte{0, 0}
 	if _, err := io.ReadAtLeast(reader, header, 2); err != nil {
-		return ctx, err
+		return nil, err
 	}
 
 	// Ensure we are compatible
 	if header[0] != userAuthVersion {
-		return ctx, fmt.Errorf("unsupported auth version: %v", header[0])
+		return nil, fmt.Errorf("unsupported auth version: %v", header[0])
 	}
 
 	// Get the user name
 	userLen := int(header[1])
 	user := make([]byte, userLen)
 	if _, err := io.ReadAtLeast(reader, user, userLen); err != nil {
-		return ctx, err
+		return nil, err
 	}
 
 	// Get the password length
 	if _, err := reader.Read(header[:1]); err != nil {
-		return ctx, err
+		return nil, err
 	}
 
 	// Get the password
 	passLen := int(header[0])
 	pass := make([]byte, passLen)
 	if _, err := io.ReadAtLeast(reader, pass, passLen); err != nil {
-		return ctx, err
+		return nil, err
 	}
 
 	// Verify the password
-	ctx, isValid := a.Credentials.Valid(ctx, string(user), string(pass))
-	if isValid {
-		if _, err := writer.Write([]byte{userAuthVersion, authSuccess}); err != nil {
-			return ctx, err
-		}
-	} else {
+	isValid, attrs := a.Credentials.Valid(ctx, string(user), string(pass))
+	if !isValid {
 		if _, err := writer.Write([]byte{userAuthVersion, authFailure}); err != nil {
-			return ctx, err
+			return nil, err
 		}
-		return ctx, UserAuthFailed
+		return nil, UserAuthFailed
 	}
 
-	// Done
-	return ctx, nil
+	if _, err := writer.Write([]byte{userAuthVersion, authSuccess}); err != nil {
+		return nil, err
+	}
+
+	// Build the payload, starting with the username and layering in any
+	// attributes the credential store enriched it with (e.g. group/role)
+	payload := map[string]string{"Username": string(user)}
+	for k, v := range attrs {
+		payload[k] = v
+	}
+
+	return &AuthContext{Method: UserPassAuth, Payload: payload}, nil
 }
 
-// Authenticate is used to handle connection authentication
-func (s *Server) Authenticate(ctx context.Context, conn io.Writer, bufConn io.Reader) (context.Context, uint8, error) {
+// Authenticate is used to handle connection authentication on a raw
+// connection that has not yet had its version byte consumed.
+func (s *Server) Authenticate(ctx context.Context, conn io.Writer, bufConn io.Reader) (*AuthContext, uint8, error) {
 	// Read the version byte
 	version := []byte{0}
 	if _, err := bufConn.Read(version); err != nil {
-		return ctx, 0, fmt.Errorf("[ERR] socks: Failed to get version byte: %v", err)
+		return nil, 0, fmt.Errorf("[ERR] socks: Failed to get version byte: %v", err)
 	}
 
 	// Ensure we are compatible
 	if version[0] != socks5Version {
 		err := fmt.Errorf("unsupported SOCKS version: %v", version)
-		return ctx, 0, fmt.Errorf("[ERR] socks: %v", err)
+		return nil, 0, fmt.Errorf("[ERR] socks: %v", err)
 	}
 
+	return s.authenticate(ctx, conn, bufConn)
+}
+
+// authenticate selects and runs an authenticator from the already
+// version-checked method list; used by ServeConn, which has already
+// consumed the version byte itself.
+func (s *Server) authenticate(ctx context.Context, conn io.Writer, bufConn io.Reader) (*AuthContext, uint8, error) {
 	// Get the methods
 	methods, err := readMethods(bufConn)
 	if err != nil {
-		return ctx, 0, fmt.Errorf("failed to get auth methods: %v", err)
+		return nil, 0, fmt.Errorf("failed to get auth methods: %v", err)
 	}
 
 	// Select a usable method
@@ -127,15 +173,15 @@ func (s *Server) Authenticate(ctx context.Context, conn io.Writer, bufConn io.Re
 		if !found {
 			continue
 		}
-		ctx, err := authenticator.Authenticate(ctx, bufConn, conn)
+		authCtx, err := authenticator.Authenticate(ctx, bufConn, conn)
 		if err != nil {
-			return ctx, 0, err
+			return nil, 0, err
 		}
-		return ctx, method, err
+		return authCtx, method, err
 	}
 
 	// No usable method found
-	return ctx, 0, noAcceptableAuth(conn)
+	return nil, 0, noAcceptableAuth(conn)
 }
 
 // noAcceptableAuth is used to handle when we have no eligible
@@ -14,7 +14,7 @@ func TestNoAuth(t *testing.T) {
 	s, _ := New(&Config{})
 	ctx := context.Background()
 
-	ctx, authMethod, err := s.authenticate(ctx, &resp, req)
+	authCtx, authMethod, err := s.authenticate(ctx, &resp, req)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -23,6 +23,10 @@ func TestNoAuth(t *testing.T) {
 		t.Fatal("Invalid AuthMethod")
 	}
 
+	if authCtx.Method != NoAuth {
+		t.Fatal("Invalid AuthContext")
+	}
+
 	out := resp.Bytes()
 	if !bytes.Equal(out, []byte{socks5Version, NoAuth}) {
 		t.Fatalf("bad: %v", out)
@@ -44,7 +48,7 @@ func TestPasswordAuth_Valid(t *testing.T) {
 	s, _ := New(&Config{AuthMethods: []Authenticator{cator}})
 	ctx := context.Background()
 
-	ctx, authMethod, err := s.authenticate(ctx, &resp, req)
+	authCtx, authMethod, err := s.authenticate(ctx, &resp, req)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -53,6 +57,10 @@ func TestPasswordAuth_Valid(t *testing.T) {
 		t.Fatal("Invalid AuthMethod")
 	}
 
+	if authCtx.Payload["Username"] != "foo" {
+		t.Fatalf("bad payload: %v", authCtx.Payload)
+	}
+
 	out := resp.Bytes()
 	if !bytes.Equal(out, []byte{socks5Version, UserPassAuth, 1, authSuccess}) {
 		t.Fatalf("bad: %v", out)
@@ -72,13 +80,13 @@ func TestPasswordAuth_Invalid(t *testing.T) {
 	s, _ := New(&Config{AuthMethods: []Authenticator{cator}})
 	ctx := context.Background()
 
-	ctx, authMethod, err := s.authenticate(ctx, &resp, req)
+	authCtx, _, err := s.authenticate(ctx, &resp, req)
 	if err != UserAuthFailed {
 		t.Fatalf("err: %v", err)
 	}
 
-	if authMethod != NoAuth {
-		t.Fatal("Invalid AuthMethod")
+	if authCtx != nil {
+		t.Fatal("Invalid AuthContext")
 	}
 
 	out := resp.Bytes()
@@ -100,13 +108,13 @@ func TestNoSupportedAuth(t *testing.T) {
 	s, _ := New(&Config{AuthMethods: []Authenticator{cator}})
 	ctx := context.Background()
 
-	ctx, authMethod, err := s.authenticate(ctx, &resp, req)
+	authCtx, _, err := s.authenticate(ctx, &resp, req)
 	if err != NoSupportedAuth {
 		t.Fatalf("err: %v", err)
 	}
 
-	if authMethod != NoAuth {
-		t.Fatal("Invalid AuthMethod")
+	if authCtx != nil {
+		t.Fatal("Invalid AuthContext")
 	}
 
 	out := resp.Bytes()
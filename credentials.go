@@ -2,18 +2,20 @@ package socks5
 
 import "context"
 
-// CredentialStore is used to support user/pass authentication
+// CredentialStore is used to support user/pass authentication. Valid
+// also returns an optional map of attributes (e.g. group/role) that is
+// merged into the resulting AuthContext payload.
 type CredentialStore interface {
-	Valid(ctx context.Context, user, password string) (context.Context, bool)
+	Valid(ctx context.Context, user, password string) (bool, map[string]string)
 }
 
 // StaticCredentials enables using a map directly as a credential store
 type StaticCredentials map[string]string
 
-func (s StaticCredentials) Valid(ctx context.Context, user, password string) (context.Context, bool) {
+func (s StaticCredentials) Valid(ctx context.Context, user, password string) (bool, map[string]string) {
 	pass, ok := s[user]
 	if !ok {
-		return ctx, false
+		return false, nil
 	}
-	return ctx, password == pass
+	return password == pass, nil
 }
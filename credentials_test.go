@@ -13,18 +13,48 @@ func TestStaticCredentials(t *testing.T) {
 
 	ctx := context.Background()
 
-	ctx, isValid := creds.Valid(ctx, "foo", "bar")
+	isValid, _ := creds.Valid(ctx, "foo", "bar")
 	if !isValid {
 		t.Fatalf("expect valid")
 	}
 
-	ctx, isValid = creds.Valid(ctx, "baz", "")
+	isValid, _ = creds.Valid(ctx, "baz", "")
 	if !isValid {
 		t.Fatalf("expect valid")
 	}
 
-	ctx, isValid = creds.Valid(ctx, "foo", "")
+	isValid, _ = creds.Valid(ctx, "foo", "")
 	if isValid {
 		t.Fatalf("expect valid")
 	}
 }
+
+// groupCredentials is a CredentialStore that enriches the AuthContext
+// payload with a "Group" attribute.
+type groupCredentials map[string]struct {
+	password string
+	group    string
+}
+
+func (g groupCredentials) Valid(ctx context.Context, user, password string) (bool, map[string]string) {
+	entry, ok := g[user]
+	if !ok || entry.password != password {
+		return false, nil
+	}
+	return true, map[string]string{"Group": entry.group}
+}
+
+func TestCredentialStore_EnrichesAttributes(t *testing.T) {
+	creds := groupCredentials{
+		"admin": {password: "pass", group: "admins"},
+	}
+
+	ctx := context.Background()
+	isValid, attrs := creds.Valid(ctx, "admin", "pass")
+	if !isValid {
+		t.Fatalf("expect valid")
+	}
+	if attrs["Group"] != "admins" {
+		t.Fatalf("bad attrs: %v", attrs)
+	}
+}
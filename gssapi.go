@@ -0,0 +1,252 @@
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	GSSAPIAuth = uint8(1)
+
+	gssapiVersion = uint8(1)
+
+	// Subnegotiation message types (RFC 1961 section 3).
+	gssapiMsgToken       = uint8(1)
+	gssapiMsgProtection  = uint8(2)
+	gssapiMsgWrappedData = uint8(3)
+	gssapiMsgAbort       = uint8(0xff)
+)
+
+// Per-message protection levels negotiated after the security context is
+// established (RFC 1961 section 4).
+const (
+	GSSAPINoProtection    = uint8(1)
+	GSSAPIIntegrity       = uint8(2)
+	GSSAPIConfidentiality = uint8(3)
+)
+
+// GSSAPIAborted is returned when the peer sends a mtyp=0xff message,
+// aborting the security context negotiation.
+var GSSAPIAborted = fmt.Errorf("gssapi: peer aborted the security context negotiation")
+
+// GSSAPIProvider abstracts the underlying GSS-API / Kerberos mechanism so
+// this module does not need to depend on a particular implementation
+// (e.g. gokrb5). Integrators supply a GSSAPIProvider to enable
+// GSSAPIAuthenticator.
+type GSSAPIProvider interface {
+	// AcceptSecContext processes one token received from the client. out
+	// is the (possibly empty) token to send back, and complete reports
+	// whether the security context is now fully established.
+	AcceptSecContext(token []byte) (out []byte, complete bool, err error)
+
+	// Wrap protects p at the given level for transmission to the client.
+	Wrap(level uint8, p []byte) ([]byte, error)
+
+	// Unwrap verifies/decrypts p as received from the client, returning
+	// the level it was protected at and the original payload.
+	Unwrap(p []byte) (level uint8, out []byte, err error)
+
+	// SrcName returns the authenticated client principal. Only valid
+	// once AcceptSecContext has reported the context complete.
+	SrcName() string
+}
+
+// GSSAPIAuthenticator is used to handle GSSAPI (SOCKS5 auth method 0x01)
+// authentication, as described in RFC 1961.
+type GSSAPIAuthenticator struct {
+	Provider GSSAPIProvider
+}
+
+func (a GSSAPIAuthenticator) GetCode() uint8 {
+	return GSSAPIAuth
+}
+
+func (a GSSAPIAuthenticator) Authenticate(ctx context.Context, reader io.Reader, writer io.Writer) (*AuthContext, error) {
+	if _, err := writer.Write([]byte{socks5Version, GSSAPIAuth}); err != nil {
+		return nil, err
+	}
+
+	// Exchange authentication tokens (mtyp=0x01) until the provider
+	// reports the security context complete.
+	for {
+		mtyp, payload, err := readGSSAPIMessage(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		switch mtyp {
+		case gssapiMsgToken:
+			out, complete, err := a.Provider.AcceptSecContext(payload)
+			if err != nil {
+				return nil, err
+			}
+			if len(out) > 0 {
+				if err := writeGSSAPIMessage(writer, gssapiMsgToken, out); err != nil {
+					return nil, err
+				}
+			}
+			if complete {
+				return a.negotiateProtection(reader, writer)
+			}
+		case gssapiMsgAbort:
+			return nil, GSSAPIAborted
+		default:
+			return nil, fmt.Errorf("gssapi: unexpected message type during token exchange: %v", mtyp)
+		}
+	}
+}
+
+// negotiateProtection implements the per-message protection level
+// exchange (mtyp=0x02) that follows a completed security context: the
+// server offers the levels it supports, and the client replies with its
+// chosen level. Both messages are GSS-wrapped.
+func (a GSSAPIAuthenticator) negotiateProtection(reader io.Reader, writer io.Writer) (*AuthContext, error) {
+	offer := []byte{GSSAPINoProtection, GSSAPIIntegrity, GSSAPIConfidentiality}
+	wrappedOffer, err := a.Provider.Wrap(GSSAPINoProtection, offer)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeGSSAPIMessage(writer, gssapiMsgProtection, wrappedOffer); err != nil {
+		return nil, err
+	}
+
+	mtyp, payload, err := readGSSAPIMessage(reader)
+	if err != nil {
+		return nil, err
+	}
+	if mtyp == gssapiMsgAbort {
+		return nil, GSSAPIAborted
+	}
+	if mtyp != gssapiMsgProtection {
+		return nil, fmt.Errorf("gssapi: expected protection level message, got %v", mtyp)
+	}
+
+	_, chosen, err := a.Provider.Unwrap(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(chosen) != 1 {
+		return nil, fmt.Errorf("gssapi: malformed protection level message")
+	}
+	level := chosen[0]
+	switch level {
+	case GSSAPINoProtection, GSSAPIIntegrity, GSSAPIConfidentiality:
+	default:
+		return nil, fmt.Errorf("gssapi: client chose unsupported protection level: %v", level)
+	}
+
+	authCtx := &AuthContext{
+		Method: GSSAPIAuth,
+		Payload: map[string]string{
+			"Principal":       a.Provider.SrcName(),
+			"ProtectionLevel": fmt.Sprintf("%d", level),
+		},
+	}
+
+	// Once a protection level beyond NoProtection is in effect, the
+	// request phase must transparently unwrap/wrap mtyp=0x03 frames
+	// instead of reading/writing the connection directly.
+	if level != GSSAPINoProtection {
+		authCtx.WrappedReader = &gssapiReader{provider: a.Provider, r: reader}
+		authCtx.WrappedWriter = &gssapiWriter{provider: a.Provider, level: level, w: writer}
+	}
+
+	return authCtx, nil
+}
+
+// gssapiReader unwraps mtyp=0x03 protected data frames as the request
+// phase reads from the connection.
+type gssapiReader struct {
+	provider GSSAPIProvider
+	r        io.Reader
+	buf      []byte
+}
+
+func (g *gssapiReader) Read(p []byte) (int, error) {
+	for len(g.buf) == 0 {
+		mtyp, payload, err := readGSSAPIMessage(g.r)
+		if err != nil {
+			return 0, err
+		}
+		if mtyp == gssapiMsgAbort {
+			return 0, GSSAPIAborted
+		}
+		if mtyp != gssapiMsgWrappedData {
+			return 0, fmt.Errorf("gssapi: unexpected message type in request phase: %v", mtyp)
+		}
+		_, out, err := g.provider.Unwrap(payload)
+		if err != nil {
+			return 0, err
+		}
+		g.buf = out
+	}
+
+	n := copy(p, g.buf)
+	g.buf = g.buf[n:]
+	return n, nil
+}
+
+// gssapiWriter wraps outgoing request-phase data as mtyp=0x03 protected
+// data frames.
+type gssapiWriter struct {
+	provider GSSAPIProvider
+	level    uint8
+	w        io.Writer
+}
+
+func (g *gssapiWriter) Write(p []byte) (int, error) {
+	wrapped, err := g.provider.Wrap(g.level, p)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeGSSAPIMessage(g.w, gssapiMsgWrappedData, wrapped); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// readGSSAPIMessage reads one RFC 1961 subnegotiation frame:
+// { ver=0x01, mtyp, len (2 bytes big-endian), token... }
+func readGSSAPIMessage(r io.Reader) (uint8, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if header[0] != gssapiVersion {
+		return 0, nil, fmt.Errorf("gssapi: unsupported subnegotiation version: %v", header[0])
+	}
+
+	mtyp := header[1]
+	length := binary.BigEndian.Uint16(header[2:4])
+	token := make([]byte, length)
+	if length > 0 {
+		if _, err := io.ReadFull(r, token); err != nil {
+			return 0, nil, err
+		}
+	}
+	return mtyp, token, nil
+}
+
+// writeGSSAPIMessage writes one RFC 1961 subnegotiation frame.
+func writeGSSAPIMessage(w io.Writer, mtyp uint8, token []byte) error {
+	if len(token) > math.MaxUint16 {
+		return fmt.Errorf("gssapi: token too large to frame: %d bytes", len(token))
+	}
+
+	header := make([]byte, 4)
+	header[0] = gssapiVersion
+	header[1] = mtyp
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(token)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if len(token) > 0 {
+		if _, err := w.Write(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
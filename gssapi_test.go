@@ -0,0 +1,150 @@
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+// fakeGSSAPIProvider is a trivial GSSAPIProvider used to exercise the
+// subnegotiation state machine without depending on a real Kerberos
+// library. It requires exactly two token round-trips before reporting
+// the context complete, and "wraps" data with a one-byte level prefix.
+type fakeGSSAPIProvider struct {
+	rounds int
+}
+
+func (f *fakeGSSAPIProvider) AcceptSecContext(token []byte) ([]byte, bool, error) {
+	f.rounds++
+	if f.rounds < 2 {
+		return []byte("continue"), false, nil
+	}
+	return []byte("accepted"), true, nil
+}
+
+func (f *fakeGSSAPIProvider) Wrap(level uint8, p []byte) ([]byte, error) {
+	return append([]byte{level}, p...), nil
+}
+
+func (f *fakeGSSAPIProvider) Unwrap(p []byte) (uint8, []byte, error) {
+	if len(p) < 1 {
+		return 0, nil, fmt.Errorf("short wrapped payload")
+	}
+	return p[0], p[1:], nil
+}
+
+func (f *fakeGSSAPIProvider) SrcName() string {
+	return "alice@EXAMPLE.COM"
+}
+
+func TestGSSAPIAuthenticator_MultiRoundExchange(t *testing.T) {
+	req := bytes.NewBuffer(nil)
+	writeGSSAPIMessage(req, gssapiMsgToken, []byte("token1"))
+	writeGSSAPIMessage(req, gssapiMsgToken, []byte("token2"))
+	wrappedChoice, _ := (&fakeGSSAPIProvider{}).Wrap(GSSAPINoProtection, []byte{GSSAPINoProtection})
+	writeGSSAPIMessage(req, gssapiMsgProtection, wrappedChoice)
+
+	var resp bytes.Buffer
+	cator := GSSAPIAuthenticator{Provider: &fakeGSSAPIProvider{}}
+
+	authCtx, err := cator.Authenticate(context.Background(), req, &resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if authCtx.Method != GSSAPIAuth {
+		t.Fatalf("bad method: %v", authCtx.Method)
+	}
+	if authCtx.Payload["Principal"] != "alice@EXAMPLE.COM" {
+		t.Fatalf("bad principal: %v", authCtx.Payload)
+	}
+	if authCtx.Payload["ProtectionLevel"] != "1" {
+		t.Fatalf("bad protection level: %v", authCtx.Payload)
+	}
+	if authCtx.WrappedReader != nil || authCtx.WrappedWriter != nil {
+		t.Fatalf("expected no transport wrapping at NoProtection")
+	}
+
+	// Server should have written the version/method select bytes, its
+	// "continue" and "accepted" tokens, and its protection level offer;
+	// only the select bytes are checked here.
+	out := resp.Bytes()
+	if out[0] != socks5Version || out[1] != GSSAPIAuth {
+		t.Fatalf("bad select response: %v", out)
+	}
+}
+
+func TestGSSAPIAuthenticator_IntegrityWrapsTransport(t *testing.T) {
+	req := bytes.NewBuffer(nil)
+	writeGSSAPIMessage(req, gssapiMsgToken, []byte("token1"))
+	writeGSSAPIMessage(req, gssapiMsgToken, []byte("token2"))
+	provider := &fakeGSSAPIProvider{}
+	wrappedChoice, _ := provider.Wrap(GSSAPINoProtection, []byte{GSSAPIIntegrity})
+	writeGSSAPIMessage(req, gssapiMsgProtection, wrappedChoice)
+
+	var resp bytes.Buffer
+	cator := GSSAPIAuthenticator{Provider: provider}
+
+	authCtx, err := cator.Authenticate(context.Background(), req, &resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if authCtx.Payload["ProtectionLevel"] != "2" {
+		t.Fatalf("bad protection level: %v", authCtx.Payload)
+	}
+	if authCtx.WrappedReader == nil || authCtx.WrappedWriter == nil {
+		t.Fatalf("expected transport wrapping at Integrity")
+	}
+
+	// Write through the actual WrappedWriter negotiateProtection
+	// returned; it should land on resp framed as mtyp=0x03 and protected
+	// at the negotiated level.
+	respLenBefore := resp.Len()
+	if _, err := authCtx.WrappedWriter.Write([]byte("hello")); err != nil {
+		t.Fatalf("write err: %v", err)
+	}
+	mtyp, payload, err := readGSSAPIMessage(bytes.NewReader(resp.Bytes()[respLenBefore:]))
+	if err != nil {
+		t.Fatalf("frame err: %v", err)
+	}
+	if mtyp != gssapiMsgWrappedData {
+		t.Fatalf("bad frame type: %v", mtyp)
+	}
+	level, out, err := provider.Unwrap(payload)
+	if err != nil {
+		t.Fatalf("unwrap err: %v", err)
+	}
+	if level != GSSAPIIntegrity || string(out) != "hello" {
+		t.Fatalf("bad unwrapped data: level=%v out=%q", level, out)
+	}
+
+	// Append a protected data frame to req (the same reader
+	// negotiateProtection wrapped) and confirm the actual WrappedReader
+	// transparently unwraps it.
+	protected, err := provider.Wrap(GSSAPIIntegrity, []byte("world"))
+	if err != nil {
+		t.Fatalf("wrap err: %v", err)
+	}
+	writeGSSAPIMessage(req, gssapiMsgWrappedData, protected)
+	buf := make([]byte, 5)
+	if _, err := authCtx.WrappedReader.Read(buf); err != nil {
+		t.Fatalf("read err: %v", err)
+	}
+	if string(buf) != "world" {
+		t.Fatalf("bad unwrapped data: %q", buf)
+	}
+}
+
+func TestGSSAPIAuthenticator_Abort(t *testing.T) {
+	req := bytes.NewBuffer(nil)
+	writeGSSAPIMessage(req, gssapiMsgAbort, nil)
+
+	var resp bytes.Buffer
+	cator := GSSAPIAuthenticator{Provider: &fakeGSSAPIProvider{}}
+
+	_, err := cator.Authenticate(context.Background(), req, &resp)
+	if err != GSSAPIAborted {
+		t.Fatalf("expected abort, got: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	ConnectCommand   = uint8(1)
+	BindCommand      = uint8(2)
+	AssociateCommand = uint8(3)
+
+	ipv4Address = uint8(1)
+	fqdnAddress = uint8(3)
+	ipv6Address = uint8(4)
+)
+
+const (
+	successReply uint8 = iota
+	serverFailure
+	ruleFailure
+	networkUnreachable
+	hostUnreachable
+	connectionRefused
+	ttlExpired
+	commandNotSupported
+	addrTypeNotSupported
+)
+
+var unrecognizedAddrType = fmt.Errorf("unrecognized address type")
+
+// AddrSpec carries a SOCKS5 address, either a resolved IP or an
+// as-yet-unresolved FQDN, along with the port.
+type AddrSpec struct {
+	FQDN string
+	IP   net.IP
+	Port int
+}
+
+func (a *AddrSpec) String() string {
+	if a.FQDN != "" {
+		return fmt.Sprintf("%s (%s):%d", a.FQDN, a.IP, a.Port)
+	}
+	return fmt.Sprintf("%s:%d", a.IP, a.Port)
+}
+
+// Address returns a string suitable to dial; it prefers the FQDN, if
+// set, so that the dialer may do its own resolution.
+func (a *AddrSpec) Address() string {
+	if a.FQDN != "" {
+		return net.JoinHostPort(a.FQDN, strconv.Itoa(a.Port))
+	}
+	return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+}
+
+// Request represents a single SOCKS5 request, from the request header
+// through to the proxied connection. AuthContext is populated from the
+// authentication phase so RuleSet.Allow and NameResolver.Resolve can
+// make identity-aware decisions.
+type Request struct {
+	AuthContext  *AuthContext
+	Command      uint8
+	RemoteAddr   *AddrSpec
+	DestAddr     *AddrSpec
+	realDestAddr *AddrSpec
+	bufConn      io.Reader
+}
+
+// NewRequest reads and parses a SOCKS5 request header from bufConn.
+func NewRequest(bufConn io.Reader) (*Request, error) {
+	header := []byte{0, 0, 0}
+	if _, err := io.ReadFull(bufConn, header); err != nil {
+		return nil, fmt.Errorf("failed to get command version: %v", err)
+	}
+
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported command version: %v", header[0])
+	}
+
+	dest, err := readAddrSpec(bufConn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{
+		Command:  header[1],
+		DestAddr: dest,
+		bufConn:  bufConn,
+	}, nil
+}
+
+// handleRequest resolves the destination, checks it against the
+// configured RuleSet, and dispatches to the command handler. ctx is
+// enriched with the request's AuthContext so the NameResolver can
+// consume it via AuthContextFromContext.
+func (s *Server) handleRequest(ctx context.Context, req *Request, conn io.Writer) error {
+	ctx = contextWithAuth(ctx, req.AuthContext)
+
+	dest := req.DestAddr
+	if dest.FQDN != "" {
+		var addr net.IP
+		var err error
+		ctx, addr, err = s.config.Resolver.Resolve(ctx, dest.FQDN)
+		if err != nil {
+			if err := sendReply(conn, hostUnreachable, nil); err != nil {
+				return fmt.Errorf("failed to send reply: %v", err)
+			}
+			return fmt.Errorf("failed to resolve destination %q: %v", dest.FQDN, err)
+		}
+		dest.IP = addr
+	}
+	req.realDestAddr = dest
+
+	var ok bool
+	ctx, ok = s.config.Rules.Allow(ctx, req)
+	if !ok {
+		if err := sendReply(conn, ruleFailure, nil); err != nil {
+			return fmt.Errorf("failed to send reply: %v", err)
+		}
+		return fmt.Errorf("connection to %v blocked by ruleset", dest)
+	}
+
+	switch req.Command {
+	case ConnectCommand:
+		return s.handleConnect(ctx, conn, req)
+	default:
+		if err := sendReply(conn, commandNotSupported, nil); err != nil {
+			return fmt.Errorf("failed to send reply: %v", err)
+		}
+		return fmt.Errorf("unsupported command: %v", req.Command)
+	}
+}
+
+// handleConnect implements the CONNECT command: dial the destination and
+// relay bytes in both directions.
+func (s *Server) handleConnect(ctx context.Context, conn io.Writer, req *Request) error {
+	dial := s.config.Dial
+	if dial == nil {
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	target, err := dial(ctx, "tcp", req.realDestAddr.Address())
+	if err != nil {
+		resp := hostUnreachable
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "refused"):
+			resp = connectionRefused
+		case strings.Contains(msg, "network is unreachable"):
+			resp = networkUnreachable
+		}
+		if err := sendReply(conn, resp, nil); err != nil {
+			return fmt.Errorf("failed to send reply: %v", err)
+		}
+		return fmt.Errorf("connect to %v failed: %v", req.realDestAddr, err)
+	}
+	defer target.Close()
+
+	local := target.LocalAddr().(*net.TCPAddr)
+	bind := AddrSpec{IP: local.IP, Port: local.Port}
+	if err := sendReply(conn, successReply, &bind); err != nil {
+		return fmt.Errorf("failed to send reply: %v", err)
+	}
+
+	errCh := make(chan error, 2)
+	go proxy(target, req.bufConn, errCh)
+	go proxy(conn, target, errCh)
+
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxy copies from src to dst until EOF, reporting the result on errCh.
+func proxy(dst io.Writer, src io.Reader, errCh chan<- error) {
+	_, err := io.Copy(dst, src)
+	if tcpConn, ok := dst.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	errCh <- err
+}
+
+// sendReply writes a SOCKS5 reply with the given code and bound address.
+func sendReply(w io.Writer, resp uint8, addr *AddrSpec) error {
+	var addrType uint8
+	var addrBody []byte
+	var addrPort int
+
+	switch {
+	case addr == nil:
+		addrType = ipv4Address
+		addrBody = []byte{0, 0, 0, 0}
+		addrPort = 0
+	case addr.FQDN != "":
+		addrType = fqdnAddress
+		addrBody = append([]byte{byte(len(addr.FQDN))}, []byte(addr.FQDN)...)
+		addrPort = addr.Port
+	case addr.IP.To4() != nil:
+		addrType = ipv4Address
+		addrBody = addr.IP.To4()
+		addrPort = addr.Port
+	case addr.IP.To16() != nil:
+		addrType = ipv6Address
+		addrBody = addr.IP.To16()
+		addrPort = addr.Port
+	default:
+		return fmt.Errorf("failed to format address: %v", addr)
+	}
+
+	msg := make([]byte, 0, 6+len(addrBody))
+	msg = append(msg, socks5Version, resp, 0, addrType)
+	msg = append(msg, addrBody...)
+	msg = append(msg, byte(addrPort>>8), byte(addrPort))
+
+	_, err := w.Write(msg)
+	return err
+}
+
+// readAddrSpec parses the ATYP/address/port portion of a SOCKS5 request.
+func readAddrSpec(r io.Reader) (*AddrSpec, error) {
+	d := &AddrSpec{}
+
+	atyp := []byte{0}
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return nil, err
+	}
+
+	switch atyp[0] {
+	case ipv4Address:
+		addr := make([]byte, 4)
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return nil, err
+		}
+		d.IP = net.IP(addr)
+	case ipv6Address:
+		addr := make([]byte, 16)
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return nil, err
+		}
+		d.IP = net.IP(addr)
+	case fqdnAddress:
+		length := []byte{0}
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, err
+		}
+		fqdn := make([]byte, int(length[0]))
+		if _, err := io.ReadFull(r, fqdn); err != nil {
+			return nil, err
+		}
+		d.FQDN = string(fqdn)
+	default:
+		return nil, unrecognizedAddrType
+	}
+
+	port := []byte{0, 0}
+	if _, err := io.ReadFull(r, port); err != nil {
+		return nil, err
+	}
+	d.Port = (int(port[0]) << 8) | int(port[1])
+
+	return d, nil
+}
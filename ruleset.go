@@ -0,0 +1,18 @@
+package socks5
+
+import "context"
+
+// RuleSet is used to provide custom rules to allow or prohibit actions.
+// Allow receives the fully-populated Request, including its AuthContext,
+// so rules can be written against the authenticated identity and not
+// just source IP or destination.
+type RuleSet interface {
+	Allow(ctx context.Context, req *Request) (context.Context, bool)
+}
+
+// PermitAll returns a RuleSet which allows all types of connections
+type PermitAll struct{}
+
+func (p PermitAll) Allow(ctx context.Context, req *Request) (context.Context, bool) {
+	return ctx, true
+}
@@ -0,0 +1,42 @@
+package socks5
+
+import (
+	"context"
+	"testing"
+)
+
+// usernameRuleSet only allows requests whose AuthContext carries a
+// specific username, exercising rule enforcement keyed off authenticated
+// identity rather than source IP.
+type usernameRuleSet struct {
+	allowedUser string
+}
+
+func (r usernameRuleSet) Allow(ctx context.Context, req *Request) (context.Context, bool) {
+	if req.AuthContext == nil {
+		return ctx, false
+	}
+	return ctx, req.AuthContext.Payload["Username"] == r.allowedUser
+}
+
+func TestRuleSet_AllowsByUsername(t *testing.T) {
+	rules := usernameRuleSet{allowedUser: "foo"}
+	ctx := context.Background()
+
+	allowedReq := &Request{AuthContext: &AuthContext{Method: UserPassAuth, Payload: map[string]string{"Username": "foo"}}}
+	if _, ok := rules.Allow(ctx, allowedReq); !ok {
+		t.Fatalf("expected foo to be allowed")
+	}
+
+	deniedReq := &Request{AuthContext: &AuthContext{Method: UserPassAuth, Payload: map[string]string{"Username": "bar"}}}
+	if _, ok := rules.Allow(ctx, deniedReq); ok {
+		t.Fatalf("expected bar to be denied")
+	}
+}
+
+func TestPermitAll(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := (PermitAll{}).Allow(ctx, &Request{}); !ok {
+		t.Fatalf("expected PermitAll to allow")
+	}
+}
@@ -0,0 +1,161 @@
+package socks5
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+)
+
+const socks5Version = uint8(5)
+
+// Config is used to setup and configure a Server
+type Config struct {
+	// AuthMethods to use; if not provided, NoAuth is used unless
+	// Credentials is set, in which case UserPassAuth is used.
+	AuthMethods []Authenticator
+
+	// Credentials, if provided, enables UserPassAuth when AuthMethods is
+	// not explicitly set.
+	Credentials CredentialStore
+
+	// Resolver is used to resolve FQDN destinations; defaults to DNSResolver.
+	Resolver NameResolver
+
+	// Rules is used to restrict/permit connections; defaults to PermitAll.
+	Rules RuleSet
+
+	// BindIP is reserved for bind or udp associate; it is not read, as
+	// handleRequest answers both commands with commandNotSupported.
+	BindIP net.IP
+
+	// Logger can be used to provide a custom log target; defaults to stdout
+	Logger *log.Logger
+
+	// Dial is used to establish new outbound connections; defaults to
+	// net.Dialer.DialContext.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Server is responsible for accepting connections and handling the
+// details of the SOCKS5 protocol
+type Server struct {
+	config      *Config
+	authMethods map[uint8]Authenticator
+}
+
+// New creates a new Server and potentially returns an error
+func New(conf *Config) (*Server, error) {
+	if conf.Resolver == nil {
+		conf.Resolver = DNSResolver{}
+	}
+	if conf.Rules == nil {
+		conf.Rules = PermitAll{}
+	}
+	if conf.Logger == nil {
+		conf.Logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	if len(conf.AuthMethods) == 0 {
+		if conf.Credentials != nil {
+			conf.AuthMethods = []Authenticator{UserPassAuthenticator{Credentials: conf.Credentials}}
+		} else {
+			conf.AuthMethods = []Authenticator{NoAuthAuthenticator{}}
+		}
+	}
+
+	server := &Server{
+		config:      conf,
+		authMethods: make(map[uint8]Authenticator),
+	}
+	for _, a := range conf.AuthMethods {
+		server.authMethods[a.GetCode()] = a
+	}
+
+	return server, nil
+}
+
+// ListenAndServe is a convenience function that creates a listener and
+// serves it
+func (s *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts and handles connections from the given listener
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn authenticates and handles a single SOCKS5 connection
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	bufConn := bufio.NewReader(conn)
+	ctx := context.Background()
+
+	version := []byte{0}
+	if _, err := bufConn.Read(version); err != nil {
+		err = fmt.Errorf("failed to get version byte: %v", err)
+		s.config.Logger.Printf("[ERR] socks: %v", err)
+		return err
+	}
+	if version[0] != socks5Version {
+		err := fmt.Errorf("unsupported SOCKS version: %v", version)
+		s.config.Logger.Printf("[ERR] socks: %v", err)
+		return err
+	}
+
+	authCtx, _, err := s.authenticate(ctx, conn, bufConn)
+	if err != nil {
+		err = fmt.Errorf("failed to authenticate: %v", err)
+		s.config.Logger.Printf("[ERR] socks: %v", err)
+		return err
+	}
+
+	// The request phase reads/writes through whatever transport the
+	// authenticator negotiated; for GSSAPI with a protection level beyond
+	// NoProtection, that's a reader/writer that unwraps/wraps frames
+	// rather than the raw connection.
+	reqReader := io.Reader(bufConn)
+	reqWriter := io.Writer(conn)
+	if authCtx.WrappedReader != nil {
+		reqReader = authCtx.WrappedReader
+	}
+	if authCtx.WrappedWriter != nil {
+		reqWriter = authCtx.WrappedWriter
+	}
+
+	request, err := NewRequest(reqReader)
+	if err != nil {
+		if err == unrecognizedAddrType {
+			if err := sendReply(reqWriter, addrTypeNotSupported, nil); err != nil {
+				return fmt.Errorf("failed to send reply: %v", err)
+			}
+		}
+		return fmt.Errorf("failed to read destination address: %v", err)
+	}
+	request.AuthContext = authCtx
+	if client, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		request.RemoteAddr = &AddrSpec{IP: client.IP, Port: client.Port}
+	}
+
+	if err := s.handleRequest(ctx, request, reqWriter); err != nil {
+		err = fmt.Errorf("failed to handle request: %v", err)
+		s.config.Logger.Printf("[ERR] socks: %v", err)
+		return err
+	}
+
+	return nil
+}